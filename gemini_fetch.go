@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	geminiFetchTimeout  = 10 * time.Second
+	geminiMaxBodyBytes  = 1 << 20 // ~1 MiB
+	geminiDefaultPort   = "1965"
+	geminiKnownHostsDir = ".ralph"
+	geminiKnownHostsTXT = "known_hosts"
+)
+
+// geminiOutline is the heading/link structure the LLM gets back alongside a
+// text/gemini body, so it can reason about the page without re-parsing it.
+type geminiOutline struct {
+	Headings []string `json:"headings"`
+	Links    []string `json:"links"`
+}
+
+// fetchGeminiURL performs a Gemini-protocol request: TLS-dial the host on
+// port 1965 (TOFU-pinning the certificate fingerprint under
+// ~/.ralph/known_hosts), send the CRLF-terminated URL, and parse the
+// "<status> <meta>\r\n" response header followed by the body. For text/*
+// responses, text holds the body transcoded to UTF-8 per the charset named
+// in meta; body always holds the raw bytes as received.
+func fetchGeminiURL(rawURL string) (status int, meta string, mimeType string, body []byte, text string, outline *geminiOutline, err error) {
+	if !strings.HasPrefix(rawURL, "gemini://") {
+		return 0, "", "", nil, "", nil, fmt.Errorf("not a gemini:// URL: %s", rawURL)
+	}
+
+	host := strings.TrimPrefix(rawURL, "gemini://")
+	if idx := strings.IndexAny(host, "/"); idx >= 0 {
+		host = host[:idx]
+	}
+	if !strings.Contains(host, ":") {
+		host += ":" + geminiDefaultPort
+	}
+
+	dialer := &net.Dialer{Timeout: geminiFetchTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return 0, "", "", nil, "", nil, fmt.Errorf("dialing %s: %w", host, err)
+	}
+	defer conn.Close()
+
+	if err := verifyKnownHost(host, conn); err != nil {
+		return 0, "", "", nil, "", nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(geminiFetchTimeout))
+
+	if _, err := conn.Write([]byte(rawURL + "\r\n")); err != nil {
+		return 0, "", "", nil, "", nil, fmt.Errorf("sending request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, "", "", nil, "", nil, fmt.Errorf("reading response header: %w", err)
+	}
+	header = strings.TrimRight(header, "\r\n")
+
+	parts := strings.SplitN(header, " ", 2)
+	status, convErr := strconv.Atoi(parts[0])
+	if convErr != nil {
+		return 0, "", "", nil, "", nil, fmt.Errorf("malformed status in header %q", header)
+	}
+	if len(parts) > 1 {
+		meta = parts[1]
+	}
+
+	limited := io.LimitReader(reader, geminiMaxBodyBytes)
+	body, err = io.ReadAll(limited)
+	if err != nil {
+		return status, meta, "", nil, "", nil, fmt.Errorf("reading body: %w", err)
+	}
+
+	mimeType = meta
+	if status/10 == 2 {
+		mimeType, _, _ = strings.Cut(meta, ";")
+		mimeType = strings.TrimSpace(mimeType)
+		if mimeType == "" {
+			mimeType = "text/gemini"
+		}
+		if strings.HasPrefix(mimeType, "text/") {
+			text, err = decodeGeminiText(body, meta)
+			if err != nil {
+				return status, meta, mimeType, body, "", nil, fmt.Errorf("decoding body charset: %w", err)
+			}
+		}
+		if mimeType == "text/gemini" {
+			o := parseGeminiOutline(text)
+			outline = &o
+		}
+	}
+
+	return status, meta, mimeType, body, text, outline, nil
+}
+
+// decodeGeminiText transcodes a text/* body to UTF-8 using the charset named
+// in the response's meta (a Content-Type-shaped "type/subtype; charset=..."
+// string), falling back to charset.NewReader's own content sniffing when
+// meta carries no charset parameter.
+func decodeGeminiText(body []byte, meta string) (string, error) {
+	r, err := charset.NewReader(bytes.NewReader(body), meta)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// parseGeminiOutline extracts headings ("#", "##", "###" lines) and link
+// targets ("=>" lines) from a text/gemini document.
+func parseGeminiOutline(body string) geminiOutline {
+	var outline geminiOutline
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "#"):
+			outline.Headings = append(outline.Headings, strings.TrimSpace(strings.TrimLeft(line, "#")))
+		case strings.HasPrefix(line, "=>"):
+			// "=> URL [label]": keep only the URL, not the label.
+			if fields := strings.Fields(strings.TrimPrefix(line, "=>")); len(fields) > 0 {
+				outline.Links = append(outline.Links, fields[0])
+			}
+		}
+	}
+
+	return outline
+}
+
+// verifyKnownHost implements trust-on-first-use pinning: the first time a
+// host is seen its leaf certificate fingerprint is recorded under
+// ~/.ralph/known_hosts; subsequent connections must match or the request is
+// refused.
+func verifyKnownHost(host string, conn *tls.Conn) error {
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no peer certificate presented by %s", host)
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	path, err := knownHostsPath()
+	if err != nil {
+		return err
+	}
+
+	known, err := readKnownHosts(path)
+	if err != nil {
+		return err
+	}
+
+	if existing, ok := known[host]; ok {
+		if existing != fingerprint {
+			return fmt.Errorf("certificate fingerprint for %s changed: expected %s, got %s", host, existing, fingerprint)
+		}
+		return nil
+	}
+
+	known[host] = fingerprint
+	return writeKnownHosts(path, known)
+}
+
+func knownHostsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolving home directory: %w", err)
+	}
+	dir := filepath.Join(home, geminiKnownHostsDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating %s: %w", dir, err)
+	}
+	return filepath.Join(dir, geminiKnownHostsTXT), nil
+}
+
+func readKnownHosts(path string) (map[string]string, error) {
+	known := map[string]string{}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return known, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading known_hosts: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) == 2 {
+			known[fields[0]] = fields[1]
+		}
+	}
+	return known, nil
+}
+
+func writeKnownHosts(path string, known map[string]string) error {
+	var b strings.Builder
+	for host, fingerprint := range known {
+		fmt.Fprintf(&b, "%s %s\n", host, fingerprint)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}
+
+// executeFetchGeminiURL implements the fetch_gemini_url tool: it fetches the
+// given gemini:// URL and returns status/meta/MIME-type plus either the
+// decoded body (for text/gemini or other text MIME types) or a base64 blob.
+func executeFetchGeminiURL(args map[string]interface{}) string {
+	rawURL, ok := args["url"].(string)
+	if !ok {
+		return `{"error": "url parameter must be a string"}`
+	}
+
+	status, meta, mimeType, body, text, outline, err := fetchGeminiURL(rawURL)
+	if err != nil {
+		resp, _ := json.Marshal(map[string]interface{}{"error": err.Error()})
+		return string(resp)
+	}
+
+	response := map[string]interface{}{
+		"status":    status,
+		"meta":      meta,
+		"mime_type": mimeType,
+	}
+
+	if strings.HasPrefix(mimeType, "text/") {
+		response["body"] = text
+	} else {
+		response["body_base64"] = base64.StdEncoding.EncodeToString(body)
+	}
+
+	if outline != nil {
+		response["outline"] = outline
+	}
+
+	jsonResp, _ := json.Marshal(response)
+	return string(jsonResp)
+}
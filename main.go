@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/fs"
 	"log"
 	"math"
+	"net"
 	"net/http"
+	"net/mail"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -16,10 +21,29 @@ import (
 //go:embed static/*
 var staticFiles embed.FS
 
+// activeProvider is the Provider selected by RALPH_CONFIG (or the
+// GEMINI_API_KEY fallback) at startup, and used by every handler.
+var activeProvider Provider
+
 func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("loading config: %v", err)
+	}
+	registerProviders(cfg)
+
+	var ok bool
+	activeProvider, ok = GetProvider(cfg.Provider)
+	if !ok {
+		log.Fatalf("unknown provider %q in RALPH_CONFIG", cfg.Provider)
+	}
+	log.Printf("Using LLM provider: %s", activeProvider.Name())
+
+	loadToolsManifest()
+
 	// Strip the "static" prefix from the filesystem
 	staticFS, _ := fs.Sub(staticFiles, "static")
-	
+
 	// Serve static assets via /static/ path
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
 
@@ -36,6 +60,10 @@ func main() {
 	// Function calling endpoint
 	http.HandleFunc("/api/chat", handleChatWithFunctions)
 
+	// Persistent chat session endpoints
+	http.HandleFunc("/api/sessions", handleCreateSession)
+	http.HandleFunc("/api/sessions/", handleSessionByID)
+
 	port := os.Getenv("PORT")
 	if port == "" { port = "8080" }
 
@@ -63,73 +91,31 @@ func handleGeminiRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	geminiAPIKey := os.Getenv("GEMINI_API_KEY")
-	if geminiAPIKey == "" {
-		http.Error(w, "Gemini API key not configured", http.StatusInternalServerError)
+	contents := []map[string]interface{}{
+		{
+			"role":  "user",
+			"parts": []map[string]interface{}{{"text": request.Message}},
+		},
+	}
+
+	if wantsEventStream(r) {
+		streamSingleTurn(w, r, contents)
 		return
 	}
 
-	// Call Gemini API
-	response, err := callGeminiAPI(request.Message, geminiAPIKey)
+	resp, err := activeProvider.Generate(r.Context(), contents, nil)
 	if err != nil {
-		log.Printf("Gemini API error: %v", err)
-		http.Error(w, "Error calling Gemini API", http.StatusInternalServerError)
+		log.Printf("%s provider error: %v", activeProvider.Name(), err)
+		http.Error(w, "Error calling LLM provider", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"response": response,
+		"response": resp.Text,
 	})
 }
 
-func callGeminiAPI(message string, apiKey string) (string, error) {
-	url := "https://generativelanguage.googleapis.com/v1/models/gemini-2.0-flash-latest:generateContent?key=" + apiKey
-
-	payload := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{
-						"text": message,
-					},
-				},
-			},
-		},
-	}
-
-	jsonData, _ := json.Marshal(payload)
-	resp, err := http.Post(url, "application/json", strings.NewReader(string(jsonData)))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	body, _ := io.ReadAll(resp.Body)
-	json.Unmarshal(body, &result)
-
-	// Log response for debugging
-	log.Printf("Gemini API Status: %d, Response: %s", resp.StatusCode, string(body))
-
-	// Extract text from response
-	if candidates, ok := result["candidates"].([]interface{}); ok && len(candidates) > 0 {
-		if candidate, ok := candidates[0].(map[string]interface{}); ok {
-			if content, ok := candidate["content"].(map[string]interface{}); ok {
-				if parts, ok := content["parts"].([]interface{}); ok && len(parts) > 0 {
-					if part, ok := parts[0].(map[string]interface{}); ok {
-						if text, ok := part["text"].(string); ok {
-							return text, nil
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return "Unable to generate response", nil
-}
-
 // Function Calling with Gemini
 
 type FunctionTool struct {
@@ -176,7 +162,7 @@ var availableFunctions = []FunctionTool{
 	},
 	{
 		Name:        "validate_email",
-		Description: "Validates if an email address has a proper format.",
+		Description: "Validates an email address's syntax per RFC 5322, and optionally checks whether its domain has MX records.",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -184,13 +170,17 @@ var availableFunctions = []FunctionTool{
 					"type":        "string",
 					"description": "The email address to validate",
 				},
+				"check_mx": map[string]interface{}{
+					"type":        "boolean",
+					"description": "If true, also look up the domain's MX records (3s timeout)",
+				},
 			},
 			"required": []string{"email"},
 		},
 	},
 	{
 		Name:        "text_length_analysis",
-		Description: "Analyzes text length, word count, and character statistics.",
+		Description: "Analyzes text length, word/sentence/character counts, Flesch-Kincaid grade level, and top word frequencies.",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -202,6 +192,32 @@ var availableFunctions = []FunctionTool{
 			"required": []string{"text"},
 		},
 	},
+	{
+		Name:        "fetch_gemini_url",
+		Description: "Fetches a gemini:// URL over the Gemini protocol and returns its status, meta, MIME type, and body (plus a heading/link outline, for text/gemini pages).",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"url": map[string]interface{}{
+					"type":        "string",
+					"description": "The gemini:// URL to fetch",
+				},
+			},
+			"required": []string{"url"},
+		},
+	},
+}
+
+// Maximum number of tool-execution round trips before giving up with an
+// "exceeded maximum function call iterations" error.
+const maxFunctionCallIterations = 5
+
+// ToolCallTrace records a single function invocation during a chat turn so
+// callers can see what the model did, not just the final answer.
+type ToolCallTrace struct {
+	Name   string                 `json:"name"`
+	Args   map[string]interface{} `json:"args"`
+	Result string                 `json:"result"`
 }
 
 func handleChatWithFunctions(w http.ResponseWriter, r *http.Request) {
@@ -211,7 +227,8 @@ func handleChatWithFunctions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var request struct {
-		Message string `json:"message"`
+		SessionID string `json:"session_id"`
+		Message   string `json:"message"`
 	}
 
 	body, _ := io.ReadAll(r.Body)
@@ -222,29 +239,104 @@ func handleChatWithFunctions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	geminiAPIKey := os.Getenv("GEMINI_API_KEY")
-	if geminiAPIKey == "" {
-		http.Error(w, "Gemini API key not configured", http.StatusInternalServerError)
+	var sess *chatSession
+	if request.SessionID != "" {
+		var err error
+		sess, err = loadSession(request.SessionID)
+		if err != nil {
+			http.Error(w, "Unknown session_id", http.StatusNotFound)
+			return
+		}
+	}
+
+	contents := []map[string]interface{}{}
+	if sess != nil {
+		contents = append(contents, sess.Contents...)
+	}
+	contents = append(contents, map[string]interface{}{
+		"role":  "user",
+		"parts": []map[string]interface{}{{"text": request.Message}},
+	})
+
+	if wantsEventStream(r) {
+		streamWithFunctions(w, r, contents, sess)
 		return
 	}
 
-	// Call Gemini with basic text generation
-	response, err := callGeminiAPI(request.Message, geminiAPIKey)
+	response, trace, finalContents, err := callWithFunctions(r.Context(), contents)
 	if err != nil {
-		log.Printf("Gemini API error: %v", err)
-		http.Error(w, "Error calling Gemini API", http.StatusInternalServerError)
+		log.Printf("%s provider error: %v", activeProvider.Name(), err)
+		http.Error(w, "Error calling LLM provider", http.StatusInternalServerError)
 		return
 	}
 
+	if sess != nil {
+		sess.Contents = finalContents
+		if err := saveSession(sess); err != nil {
+			log.Printf("saving session %s: %v", sess.ID, err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"response": response,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response":   response,
+		"tool_calls": trace,
 	})
 }
 
-func callGeminiWithFunctions(message string, apiKey string) (string, error) {
-	// For now, use the basic API without function calling
-	return callGeminiAPI(message, apiKey)
+// callWithFunctions drives a multi-turn tool-execution loop against
+// activeProvider: it sends the conversation plus the declared tools, and
+// whenever the provider responds with a function call it dispatches through
+// executeFunctionSafely, feeds the result back as a functionResponse part,
+// and asks again. It stops as soon as the provider answers with plain text,
+// or after maxFunctionCallIterations round trips, whichever comes first.
+func callWithFunctions(ctx context.Context, contents []map[string]interface{}) (string, []ToolCallTrace, []map[string]interface{}, error) {
+	trace := []ToolCallTrace{}
+
+	for i := 0; i < maxFunctionCallIterations; i++ {
+		resp, err := activeProvider.Generate(ctx, contents, availableFunctions)
+		if err != nil {
+			return "", trace, contents, err
+		}
+
+		if resp.FunctionCall == nil {
+			contents = append(contents, map[string]interface{}{
+				"role":  "model",
+				"parts": []map[string]interface{}{{"text": resp.Text}},
+			})
+			return resp.Text, trace, contents, nil
+		}
+
+		contents = append(contents, map[string]interface{}{
+			"role":  "model",
+			"parts": []map[string]interface{}{{"functionCall": resp.FunctionCall}},
+		})
+
+		name, _ := resp.FunctionCall["name"].(string)
+		args, _ := resp.FunctionCall["args"].(map[string]interface{})
+		resultJSON := executeFunctionSafely(name, args)
+
+		trace = append(trace, ToolCallTrace{Name: name, Args: args, Result: resultJSON})
+
+		var decoded interface{}
+		json.Unmarshal([]byte(resultJSON), &decoded)
+
+		contents = append(contents, map[string]interface{}{
+			"role": "user",
+			"parts": []map[string]interface{}{
+				{
+					"functionResponse": map[string]interface{}{
+						"name": name,
+						"response": map[string]interface{}{
+							"result": decoded,
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return "", trace, contents, errors.New("exceeded maximum function call iterations")
 }
 
 func executeFunctionSafely(name string, args map[string]interface{}) string {
@@ -257,7 +349,12 @@ func executeFunctionSafely(name string, args map[string]interface{}) string {
 		return executeValidateEmail(args)
 	case "text_length_analysis":
 		return executeTextAnalysis(args)
+	case "fetch_gemini_url":
+		return executeFetchGeminiURL(args)
 	default:
+		if proc, ok := pluginRegistry[name]; ok {
+			return executePluginTool(proc, name, args)
+		}
 		return `{"error": "Unknown function: ` + name + `"}`
 	}
 }
@@ -342,19 +439,129 @@ func executeValidateEmail(args map[string]interface{}) string {
 		return `{"error": "email parameter must be a string"}`
 	}
 
-	// Basic email validation
-	isValid := strings.Contains(email, "@") && strings.Contains(email, ".") && len(email) > 5
-	
+	addr, parseErr := mail.ParseAddress(email)
+	syntacticValid := parseErr == nil
+
+	var domain string
+	if syntacticValid {
+		if _, d, found := strings.Cut(addr.Address, "@"); found {
+			domain = d
+		}
+	}
+
 	response := map[string]interface{}{
-		"email":   email,
-		"valid":   isValid,
-		"message": map[bool]string{true: "Email format is valid", false: "Email format is invalid"}[isValid],
+		"email":            email,
+		"syntactic_valid":  syntacticValid,
+		"domain":           domain,
+		"mx_hosts":         []string{},
+		"deliverable_hint": false,
+	}
+
+	checkMX, _ := args["check_mx"].(bool)
+	if checkMX && syntacticValid && domain != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		mxRecords, err := net.DefaultResolver.LookupMX(ctx, domain)
+		if err != nil {
+			response["mx_error"] = err.Error()
+		} else {
+			hosts := make([]string, len(mxRecords))
+			for i, mx := range mxRecords {
+				hosts[i] = mx.Host
+			}
+			response["mx_hosts"] = hosts
+			response["deliverable_hint"] = len(hosts) > 0
+		}
 	}
 
 	jsonResp, _ := json.Marshal(response)
 	return string(jsonResp)
 }
 
+// sentenceTerminators are the runes that end a sentence. A run of several in
+// a row (e.g. "Wait...!") still counts as a single boundary.
+var sentenceTerminators = map[rune]bool{
+	'.': true, '!': true, '?': true, '…': true, '。': true, '！': true, '？': true,
+}
+
+func countSentences(text string) int {
+	count := 0
+	inRun := false
+	for _, r := range text {
+		if sentenceTerminators[r] {
+			if !inRun {
+				count++
+				inRun = true
+			}
+		} else {
+			inRun = false
+		}
+	}
+	return count
+}
+
+// countSyllables gives a rough syllable count for an English word: the
+// number of vowel-sound groups, dropping a silent trailing "e".
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	const vowels = "aeiouy"
+
+	count := 0
+	prevWasVowel := false
+	for _, r := range word {
+		isVowel := strings.ContainsRune(vowels, r)
+		if isVowel && !prevWasVowel {
+			count++
+		}
+		prevWasVowel = isVowel
+	}
+	if strings.HasSuffix(word, "e") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+// wordFrequency is one entry of the top-N most frequent words in a text.
+type wordFrequency struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+const topWordCount = 5
+
+// topWordFrequencies returns the topWordCount most common words in the
+// given word list, stripped of surrounding punctuation and lowercased.
+func topWordFrequencies(words []string) []wordFrequency {
+	counts := map[string]int{}
+	for _, w := range words {
+		w = strings.ToLower(strings.Trim(w, ".,!?;:\"'()[]"))
+		if w == "" {
+			continue
+		}
+		counts[w]++
+	}
+
+	freqs := make([]wordFrequency, 0, len(counts))
+	for w, c := range counts {
+		freqs = append(freqs, wordFrequency{Word: w, Count: c})
+	}
+	sort.Slice(freqs, func(i, j int) bool {
+		if freqs[i].Count != freqs[j].Count {
+			return freqs[i].Count > freqs[j].Count
+		}
+		return freqs[i].Word < freqs[j].Word
+	})
+
+	if len(freqs) > topWordCount {
+		freqs = freqs[:topWordCount]
+	}
+	return freqs
+}
+
 func executeTextAnalysis(args map[string]interface{}) string {
 	text, ok := args["text"].(string)
 	if !ok {
@@ -362,13 +569,31 @@ func executeTextAnalysis(args map[string]interface{}) string {
 	}
 
 	words := strings.Fields(text)
-	
+	sentences := countSentences(text)
+
+	var averageWordLen float64
+	if len(words) > 0 {
+		averageWordLen = float64(len(text)) / float64(len(words))
+	}
+
+	var fleschKincaidGrade float64
+	if len(words) > 0 && sentences > 0 {
+		syllables := 0
+		for _, w := range words {
+			syllables += countSyllables(w)
+		}
+		fleschKincaidGrade = 0.39*(float64(len(words))/float64(sentences)) +
+			11.8*(float64(syllables)/float64(len(words))) - 15.59
+	}
+
 	response := map[string]interface{}{
-		"text_length":      len(text),
-		"word_count":       len(words),
-		"character_count":  len([]rune(text)),
-		"sentence_count":   strings.Count(text, ".") + strings.Count(text, "!") + strings.Count(text, "?"),
-		"average_word_len": float64(len(text)) / float64(len(words)),
+		"text_length":          len(text),
+		"word_count":           len(words),
+		"character_count":      len([]rune(text)),
+		"sentence_count":       sentences,
+		"average_word_len":     averageWordLen,
+		"flesch_kincaid_grade": fleschKincaidGrade,
+		"top_words":            topWordFrequencies(words),
 	}
 
 	jsonResp, _ := json.Marshal(response)
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Response is what a Provider returns for one generateContent-style call:
+// either plain text, or a function call the caller must dispatch and feed
+// back in before asking again.
+type Response struct {
+	Text         string
+	FunctionCall map[string]interface{}
+}
+
+// Provider is the seam between the orchestrator and a specific LLM backend.
+// Implementations translate the shared Gemini-shaped `contents` history and
+// tool declarations into whatever their backend expects.
+type Provider interface {
+	Name() string
+	Generate(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool) (Response, error)
+
+	// GenerateStream behaves like Generate but invokes onChunk with each
+	// incremental piece of text as it arrives, for providers that support
+	// token streaming. Providers without native streaming support may call
+	// onChunk once with the full text. ctx is tied to the inbound HTTP
+	// request so a client disconnect cancels the upstream call.
+	GenerateStream(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, onChunk func(text string)) (Response, error)
+}
+
+var providerRegistry = map[string]Provider{}
+
+// RegisterProvider adds a Provider to the registry under its own Name().
+// Call from an init() or from main() before the active provider is selected.
+func RegisterProvider(p Provider) {
+	providerRegistry[p.Name()] = p
+}
+
+// GetProvider looks up a previously registered Provider by name.
+func GetProvider(name string) (Provider, bool) {
+	p, ok := providerRegistry[name]
+	return p, ok
+}
+
+// RalphConfig is the shape of the file pointed to by RALPH_CONFIG. It
+// selects which registered provider handles requests and carries that
+// provider's own settings.
+type RalphConfig struct {
+	Provider string `json:"provider"`
+
+	Gemini struct {
+		APIKey string `json:"api_key"`
+		Model  string `json:"model"`
+	} `json:"gemini"`
+
+	OpenAI struct {
+		APIKey string `json:"api_key"`
+		Model  string `json:"model"`
+	} `json:"openai"`
+
+	AzureOpenAI struct {
+		APIKey     string `json:"api_key"`
+		Endpoint   string `json:"endpoint"`
+		Deployment string `json:"deployment"`
+	} `json:"azure_openai"`
+
+	Local struct {
+		Response string `json:"response"`
+	} `json:"local"`
+}
+
+// loadConfig reads the provider config named by RALPH_CONFIG, if set. With
+// no RALPH_CONFIG (or an empty one) it falls back to a Gemini config backed
+// by GEMINI_API_KEY, which matches the orchestrator's original behavior.
+func loadConfig() (RalphConfig, error) {
+	var cfg RalphConfig
+
+	path := os.Getenv("RALPH_CONFIG")
+	if path == "" {
+		cfg.Provider = "gemini"
+		cfg.Gemini.APIKey = os.Getenv("GEMINI_API_KEY")
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading RALPH_CONFIG: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing RALPH_CONFIG: %w", err)
+	}
+
+	if cfg.Provider == "" {
+		cfg.Provider = "gemini"
+	}
+	if cfg.Gemini.APIKey == "" {
+		cfg.Gemini.APIKey = os.Getenv("GEMINI_API_KEY")
+	}
+
+	return cfg, nil
+}
+
+// registerProviders builds and registers every built-in Provider from the
+// loaded config. It's called once at startup.
+func registerProviders(cfg RalphConfig) {
+	RegisterProvider(&geminiProvider{apiKey: cfg.Gemini.APIKey, model: cfg.Gemini.Model})
+	RegisterProvider(&openAIProvider{apiKey: cfg.OpenAI.APIKey, model: cfg.OpenAI.Model})
+	RegisterProvider(&azureOpenAIProvider{
+		apiKey:     cfg.AzureOpenAI.APIKey,
+		endpoint:   cfg.AzureOpenAI.Endpoint,
+		deployment: cfg.AzureOpenAI.Deployment,
+	})
+	RegisterProvider(&localProvider{response: cfg.Local.Response})
+}
+
+// geminiProvider wraps the existing generateContent call path so it can be
+// selected through the registry like any other backend.
+type geminiProvider struct {
+	apiKey string
+	model  string
+}
+
+func (p *geminiProvider) Name() string { return "gemini" }
+
+func (p *geminiProvider) Generate(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool) (Response, error) {
+	if p.apiKey == "" {
+		return Response{}, fmt.Errorf("gemini provider: GEMINI_API_KEY not configured")
+	}
+
+	result, err := callGeminiGenerateContent(ctx, contents, tools, p.apiKey)
+	if err != nil {
+		return Response{}, err
+	}
+
+	parts := geminiResponseParts(result)
+	if len(parts) == 0 {
+		return Response{Text: "Unable to generate response"}, nil
+	}
+
+	functionCall, text := extractFunctionCall(parts)
+	return Response{Text: text, FunctionCall: functionCall}, nil
+}
+
+func (p *geminiProvider) GenerateStream(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, onChunk func(text string)) (Response, error) {
+	if p.apiKey == "" {
+		return Response{}, fmt.Errorf("gemini provider: GEMINI_API_KEY not configured")
+	}
+	return streamGeminiGenerateContent(ctx, contents, tools, p.apiKey, onChunk)
+}
+
+// callGeminiGenerateContent calls generateContent with the given message
+// history and function declarations attached, and returns the decoded JSON
+// response body.
+func callGeminiGenerateContent(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, apiKey string) (map[string]interface{}, error) {
+	url := "https://generativelanguage.googleapis.com/v1/models/gemini-2.0-flash-latest:generateContent?key=" + apiKey
+
+	payload := map[string]interface{}{
+		"contents": contents,
+	}
+	if len(tools) > 0 {
+		payload["tools"] = []map[string]interface{}{{"functionDeclarations": tools}}
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	log.Printf("Gemini API Status: %d, Response: %s", resp.StatusCode, string(body))
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// streamGeminiGenerateContent calls streamGenerateContent?alt=sse and invokes
+// onChunk with each incremental text part as it arrives. It returns the
+// concatenated text and, if the model asked to call a function, the
+// functionCall part. The chunk carrying the functionCall emits no text; text
+// chunks that arrived before it have already been passed to onChunk.
+func streamGeminiGenerateContent(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, apiKey string, onChunk func(text string)) (Response, error) {
+	url := "https://generativelanguage.googleapis.com/v1/models/gemini-2.0-flash-latest:streamGenerateContent?alt=sse&key=" + apiKey
+
+	payload := map[string]interface{}{
+		"contents": contents,
+	}
+	if len(tools) > 0 {
+		payload["tools"] = []map[string]interface{}{{"functionDeclarations": tools}}
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var functionCall map[string]interface{}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+
+		parts := geminiResponseParts(chunk)
+		fc, chunkText := extractFunctionCall(parts)
+		if fc != nil {
+			functionCall = fc
+			continue
+		}
+		if chunkText != "" {
+			text.WriteString(chunkText)
+			onChunk(chunkText)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, fmt.Errorf("reading stream: %w", err)
+	}
+
+	return Response{Text: text.String(), FunctionCall: functionCall}, nil
+}
+
+// geminiResponseParts pulls the parts array out of the first candidate of a
+// generateContent response.
+func geminiResponseParts(result map[string]interface{}) []interface{} {
+	candidates, ok := result["candidates"].([]interface{})
+	if !ok || len(candidates) == 0 {
+		return nil
+	}
+	candidate, ok := candidates[0].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	content, ok := candidate["content"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	parts, _ := content["parts"].([]interface{})
+	return parts
+}
+
+// extractFunctionCall looks for a functionCall part among the given parts.
+// If one is found it is returned along with an empty string; otherwise any text
+// parts are concatenated and returned.
+func extractFunctionCall(parts []interface{}) (map[string]interface{}, string) {
+	var text strings.Builder
+
+	for _, p := range parts {
+		part, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if fc, ok := part["functionCall"].(map[string]interface{}); ok {
+			return fc, ""
+		}
+		if t, ok := part["text"].(string); ok {
+			text.WriteString(t)
+		}
+	}
+
+	return nil, text.String()
+}
+
+const defaultOpenAIModel = "gpt-4o-mini"
+
+// openAIProvider talks to the OpenAI chat completions API, translating the
+// shared Gemini-shaped `contents` history and tool declarations into OpenAI's
+// messages/tools shape and back.
+type openAIProvider struct {
+	apiKey string
+	model  string
+}
+
+func (p *openAIProvider) Name() string { return "openai" }
+
+func (p *openAIProvider) Generate(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool) (Response, error) {
+	if p.apiKey == "" {
+		return Response{}, fmt.Errorf("openai provider: api_key not configured")
+	}
+	model := p.model
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	headers := map[string]string{"Authorization": "Bearer " + p.apiKey}
+	return callOpenAIChatCompletions(ctx, "https://api.openai.com/v1/chat/completions", headers, model, contents, tools)
+}
+
+// GenerateStream has no native streaming support yet; it falls back to a
+// single Generate call and delivers the whole answer as one chunk.
+func (p *openAIProvider) GenerateStream(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, onChunk func(text string)) (Response, error) {
+	return generateStreamFallback(ctx, p, contents, tools, onChunk)
+}
+
+// azureOpenAIProvider talks to an Azure OpenAI deployment, which exposes the
+// same chat-completions shape as OpenAI behind a deployment-scoped URL and an
+// api-key header instead of a bearer token.
+type azureOpenAIProvider struct {
+	apiKey     string
+	endpoint   string
+	deployment string
+}
+
+func (p *azureOpenAIProvider) Name() string { return "azopenai" }
+
+func (p *azureOpenAIProvider) Generate(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool) (Response, error) {
+	if p.apiKey == "" || p.endpoint == "" || p.deployment == "" {
+		return Response{}, fmt.Errorf("azopenai provider: api_key/endpoint/deployment not configured")
+	}
+	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=2024-06-01",
+		strings.TrimRight(p.endpoint, "/"), p.deployment)
+	headers := map[string]string{"api-key": p.apiKey}
+	return callOpenAIChatCompletions(ctx, url, headers, p.deployment, contents, tools)
+}
+
+// GenerateStream has no native streaming support yet; it falls back to a
+// single Generate call and delivers the whole answer as one chunk.
+func (p *azureOpenAIProvider) GenerateStream(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, onChunk func(text string)) (Response, error) {
+	return generateStreamFallback(ctx, p, contents, tools, onChunk)
+}
+
+// callOpenAIChatCompletions posts an OpenAI-shaped chat-completions request
+// (shared by openAIProvider and azureOpenAIProvider, which differ only in URL
+// and auth header) and decodes the first choice back into a Response.
+func callOpenAIChatCompletions(ctx context.Context, url string, headers map[string]string, model string, contents []map[string]interface{}, tools []FunctionTool) (Response, error) {
+	payload := map[string]interface{}{
+		"model":    model,
+		"messages": toOpenAIMessages(contents),
+	}
+	if len(tools) > 0 {
+		payload["tools"] = toOpenAITools(tools)
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	log.Printf("OpenAI-compatible API Status: %d, Response: %s", resp.StatusCode, string(body))
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return Response{}, fmt.Errorf("decoding response: %w", err)
+	}
+	if result.Error != nil {
+		return Response{}, fmt.Errorf("api error: %s", result.Error.Message)
+	}
+	if len(result.Choices) == 0 {
+		return Response{Text: "Unable to generate response"}, nil
+	}
+
+	message := result.Choices[0].Message
+	if len(message.ToolCalls) > 0 {
+		call := message.ToolCalls[0]
+		var args map[string]interface{}
+		json.Unmarshal([]byte(call.Function.Arguments), &args)
+		return Response{FunctionCall: map[string]interface{}{
+			"name": call.Function.Name,
+			"args": args,
+		}}, nil
+	}
+
+	return Response{Text: message.Content}, nil
+}
+
+// toOpenAITools translates the shared FunctionTool declarations into
+// OpenAI's `{"type": "function", "function": {...}}` tool shape.
+func toOpenAITools(tools []FunctionTool) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(tools))
+	for i, t := range tools {
+		out[i] = map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		}
+	}
+	return out
+}
+
+// toOpenAIMessages translates the shared Gemini-shaped `contents` history
+// (role plus a `parts` array of text/functionCall/functionResponse parts)
+// into OpenAI's messages shape (role plus content, with function calls
+// carried as assistant tool_calls and their results as tool messages).
+// Entries may come straight off the wire (concrete []map[string]interface{}
+// parts) or back out of a reloaded session (generic []interface{} parts
+// after a JSON round trip), so both shapes are handled.
+func toOpenAIMessages(contents []map[string]interface{}) []map[string]interface{} {
+	messages := make([]map[string]interface{}, 0, len(contents))
+	var pendingCallIDs []string
+	callCounter := 0
+
+	for _, entry := range contents {
+		role, _ := entry["role"].(string)
+		parts := asPartsSlice(entry["parts"])
+
+		var text strings.Builder
+		var toolCalls []map[string]interface{}
+		var toolMessages []map[string]interface{}
+
+		for _, part := range parts {
+			if t, ok := part["text"].(string); ok {
+				text.WriteString(t)
+			}
+			if fc, ok := part["functionCall"].(map[string]interface{}); ok {
+				callCounter++
+				id := fmt.Sprintf("call_%d", callCounter)
+				pendingCallIDs = append(pendingCallIDs, id)
+
+				name, _ := fc["name"].(string)
+				argsJSON, _ := json.Marshal(fc["args"])
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   id,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      name,
+						"arguments": string(argsJSON),
+					},
+				})
+			}
+			if fr, ok := part["functionResponse"].(map[string]interface{}); ok {
+				id := ""
+				if len(pendingCallIDs) > 0 {
+					id, pendingCallIDs = pendingCallIDs[0], pendingCallIDs[1:]
+				}
+				resultJSON, _ := json.Marshal(fr["response"])
+				toolMessages = append(toolMessages, map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": id,
+					"content":      string(resultJSON),
+				})
+			}
+		}
+
+		switch {
+		case len(toolCalls) > 0:
+			messages = append(messages, map[string]interface{}{
+				"role":       "assistant",
+				"content":    nil,
+				"tool_calls": toolCalls,
+			})
+		case len(toolMessages) > 0:
+			messages = append(messages, toolMessages...)
+		case role == "model":
+			messages = append(messages, map[string]interface{}{"role": "assistant", "content": text.String()})
+		default:
+			messages = append(messages, map[string]interface{}{"role": "user", "content": text.String()})
+		}
+	}
+
+	return messages
+}
+
+// asPartsSlice normalizes a `parts` field to []map[string]interface{},
+// whether it was built in-process ([]map[string]interface{}) or decoded off
+// a stored session ([]interface{} of map[string]interface{}, post-JSON).
+func asPartsSlice(v interface{}) []map[string]interface{} {
+	switch vv := v.(type) {
+	case []map[string]interface{}:
+		return vv
+	case []interface{}:
+		out := make([]map[string]interface{}, 0, len(vv))
+		for _, item := range vv {
+			if m, ok := item.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// localProvider is a backend-free stand-in for offline development and
+// tests: it always answers with a fixed canned response.
+type localProvider struct {
+	response string
+}
+
+func (p *localProvider) Name() string { return "local" }
+
+func (p *localProvider) Generate(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool) (Response, error) {
+	if p.response == "" {
+		return Response{Text: "local provider: no response configured"}, nil
+	}
+	return Response{Text: p.response}, nil
+}
+
+// GenerateStream delivers the canned response as a single chunk.
+func (p *localProvider) GenerateStream(ctx context.Context, contents []map[string]interface{}, tools []FunctionTool, onChunk func(text string)) (Response, error) {
+	return generateStreamFallback(ctx, p, contents, tools, onChunk)
+}
+
+// generateStreamFallback adapts a Provider that only implements Generate to
+// the GenerateStream signature by calling onChunk once with the full text.
+func generateStreamFallback(ctx context.Context, p Provider, contents []map[string]interface{}, tools []FunctionTool, onChunk func(text string)) (Response, error) {
+	resp, err := p.Generate(ctx, contents, tools)
+	if err != nil {
+		return Response{}, err
+	}
+	if resp.Text != "" {
+		onChunk(resp.Text)
+	}
+	return resp, nil
+}
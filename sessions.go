@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// ralphDataDirEnv names the environment variable that points at the
+// directory session transcripts are persisted under.
+const ralphDataDirEnv = "RALPH_DATA_DIR"
+const defaultDataDir = "ralph_data"
+const sessionsDBFile = "sessions.db"
+
+// chatSession is a persisted multi-turn conversation: the full Gemini-shaped
+// `contents` array (user/model/functionCall/functionResponse turns) that
+// gets replayed to the provider on every new message so it has memory.
+type chatSession struct {
+	ID       string                   `json:"id"`
+	Contents []map[string]interface{} `json:"contents"`
+}
+
+var (
+	sessionsDBOnce sync.Once
+	sessionsDB     *sql.DB
+	sessionsDBErr  error
+)
+
+// sessionsStore opens (creating and migrating if needed) the SQLite database
+// session transcripts are stored in, at $RALPH_DATA_DIR/sessions.db. The
+// connection is opened once and reused for the life of the process.
+func sessionsStore() (*sql.DB, error) {
+	sessionsDBOnce.Do(func() {
+		root := os.Getenv(ralphDataDirEnv)
+		if root == "" {
+			root = defaultDataDir
+		}
+		if err := os.MkdirAll(root, 0o755); err != nil {
+			sessionsDBErr = fmt.Errorf("creating %s: %w", root, err)
+			return
+		}
+
+		db, err := sql.Open("sqlite", filepath.Join(root, sessionsDBFile))
+		if err != nil {
+			sessionsDBErr = fmt.Errorf("opening sessions.db: %w", err)
+			return
+		}
+
+		const schema = `CREATE TABLE IF NOT EXISTS sessions (
+			id       TEXT PRIMARY KEY,
+			contents TEXT NOT NULL
+		)`
+		if _, err := db.Exec(schema); err != nil {
+			sessionsDBErr = fmt.Errorf("creating sessions table: %w", err)
+			return
+		}
+
+		sessionsDB = db
+	})
+	return sessionsDB, sessionsDBErr
+}
+
+// newSessionID generates a random UUID-v4-shaped identifier.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// createSession allocates a new empty session and persists it.
+func createSession() (*chatSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("generating session id: %w", err)
+	}
+
+	sess := &chatSession{ID: id, Contents: []map[string]interface{}{}}
+	if err := saveSession(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// loadSession reads a session's transcript back out of sessions.db.
+func loadSession(id string) (*chatSession, error) {
+	db, err := sessionsStore()
+	if err != nil {
+		return nil, err
+	}
+
+	var data string
+	err = db.QueryRow(`SELECT contents FROM sessions WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("loading session %s: not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading session %s: %w", id, err)
+	}
+
+	sess := &chatSession{ID: id}
+	if err := json.Unmarshal([]byte(data), &sess.Contents); err != nil {
+		return nil, fmt.Errorf("parsing session %s: %w", id, err)
+	}
+	return sess, nil
+}
+
+// saveSession upserts a session's transcript into sessions.db.
+func saveSession(sess *chatSession) error {
+	db, err := sessionsStore()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(sess.Contents)
+	if err != nil {
+		return fmt.Errorf("encoding session %s: %w", sess.ID, err)
+	}
+
+	_, err = db.Exec(`INSERT INTO sessions (id, contents) VALUES (?, ?)
+		ON CONFLICT(id) DO UPDATE SET contents = excluded.contents`, sess.ID, string(data))
+	if err != nil {
+		return fmt.Errorf("writing session %s: %w", sess.ID, err)
+	}
+	return nil
+}
+
+// deleteSession purges a session's transcript from sessions.db.
+func deleteSession(id string) error {
+	db, err := sessionsStore()
+	if err != nil {
+		return err
+	}
+
+	res, err := db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("deleting session %s: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("deleting session %s: not found", id)
+	}
+	return nil
+}
+
+// handleCreateSession implements POST /api/sessions: it allocates a new
+// session and returns its id.
+func handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess, err := createSession()
+	if err != nil {
+		http.Error(w, "Error creating session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"session_id": sess.ID})
+}
+
+// handleSessionByID implements GET and DELETE on /api/sessions/{id}.
+func handleSessionByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	if id == "" {
+		http.Error(w, "Missing session id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sess, err := loadSession(id)
+		if err != nil {
+			http.Error(w, "Unknown session_id", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sess)
+
+	case http.MethodDelete:
+		if err := deleteSession(id); err != nil {
+			http.Error(w, "Unknown session_id", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
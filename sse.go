@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// wantsEventStream reports whether the client asked for Server-Sent Events
+// instead of a one-shot JSON reply.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// sseWriter emits Server-Sent Events frames and flushes after each one so
+// the client sees them as they're produced.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+// send writes one SSE frame. event may be empty for a plain "data:" frame.
+func (s *sseWriter) send(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if event != "" {
+		s.w.Write([]byte("event: " + event + "\n"))
+	}
+	s.w.Write([]byte("data: "))
+	s.w.Write(payload)
+	s.w.Write([]byte("\n\n"))
+	s.flusher.Flush()
+}
+
+// streamSingleTurn handles a single-turn /api/ask request as SSE: each text
+// chunk from the provider is forwarded as a plain "data:" event, closed with
+// "event: done".
+func streamSingleTurn(w http.ResponseWriter, r *http.Request, contents []map[string]interface{}) {
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := activeProvider.GenerateStream(r.Context(), contents, nil, func(chunk string) {
+		sse.send("", map[string]string{"text": chunk})
+	})
+	if err != nil {
+		log.Printf("%s provider error: %v", activeProvider.Name(), err)
+		sse.send("error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	sse.send("done", map[string]string{"text": resp.Text})
+}
+
+// streamWithFunctions drives the same tool-execution loop as
+// callWithFunctions, but over SSE: text chunks are forwarded as they stream
+// in, and each tool invocation emits a "tool_call"/"tool_result" pair of
+// frames so the client can show the agent's work as it happens.
+func streamWithFunctions(w http.ResponseWriter, r *http.Request, contents []map[string]interface{}, sess *chatSession) {
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+
+	for i := 0; i < maxFunctionCallIterations; i++ {
+		resp, err := activeProvider.GenerateStream(ctx, contents, availableFunctions, func(chunk string) {
+			sse.send("", map[string]string{"text": chunk})
+		})
+		if err != nil {
+			log.Printf("%s provider error: %v", activeProvider.Name(), err)
+			sse.send("error", map[string]string{"error": err.Error()})
+			return
+		}
+
+		if resp.FunctionCall == nil {
+			contents = append(contents, map[string]interface{}{
+				"role":  "model",
+				"parts": []map[string]interface{}{{"text": resp.Text}},
+			})
+			if sess != nil {
+				sess.Contents = contents
+				if err := saveSession(sess); err != nil {
+					log.Printf("saving session %s: %v", sess.ID, err)
+				}
+			}
+			sse.send("done", map[string]string{"text": resp.Text})
+			return
+		}
+
+		contents = append(contents, map[string]interface{}{
+			"role":  "model",
+			"parts": []map[string]interface{}{{"functionCall": resp.FunctionCall}},
+		})
+
+		name, _ := resp.FunctionCall["name"].(string)
+		args, _ := resp.FunctionCall["args"].(map[string]interface{})
+		sse.send("tool_call", map[string]interface{}{"name": name, "args": args})
+
+		resultJSON := executeFunctionSafely(name, args)
+		var decoded interface{}
+		json.Unmarshal([]byte(resultJSON), &decoded)
+
+		sse.send("tool_result", map[string]interface{}{"name": name, "result": decoded})
+
+		contents = append(contents, map[string]interface{}{
+			"role": "user",
+			"parts": []map[string]interface{}{
+				{
+					"functionResponse": map[string]interface{}{
+						"name": name,
+						"response": map[string]interface{}{
+							"result": decoded,
+						},
+					},
+				},
+			},
+		})
+	}
+
+	sse.send("error", map[string]string{"error": "exceeded maximum function call iterations"})
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Default RALPH_TOOLS_MANIFEST path, and the per-call timeout a plugin tool
+// gets before its subprocess is considered a runaway and killed.
+const (
+	defaultToolsManifest  = "tools.json"
+	pluginCallTimeout     = 15 * time.Second
+	pluginDescribeTimeout = 5 * time.Second
+)
+
+// pluginManifestEntry is one entry of the tools.json manifest: an external
+// tool server the orchestrator should spawn and register as a function. The
+// manifest's own Schema is a fallback, used only if the plugin's "describe"
+// handshake (see startPlugin) doesn't return one.
+type pluginManifestEntry struct {
+	Name    string                 `json:"name"`
+	Command string                 `json:"command"`
+	Args    []string               `json:"args"`
+	Schema  map[string]interface{} `json:"schema"`
+}
+
+// pluginDescribeResult is a plugin's response to the "describe" method: the
+// description and JSON-schema parameters to register its function under.
+type pluginDescribeResult struct {
+	Description string                 `json:"description"`
+	Schema      map[string]interface{} `json:"schema"`
+}
+
+// jsonrpcRequest/jsonrpcResponse are the newline-delimited JSON-RPC messages
+// exchanged with a plugin subprocess over stdio.
+type jsonrpcRequest struct {
+	ID     int         `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// pluginProcess is a running MCP-style tool subprocess: requests are written
+// to its stdin and matched against responses read back from its stdout by
+// request id, so calls can be made concurrently.
+type pluginProcess struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *limitedBuffer
+
+	description string
+	schema      map[string]interface{}
+
+	writeMu sync.Mutex
+	nextID  int
+
+	pendingMu sync.Mutex
+	pending   map[int]chan jsonrpcResponse
+}
+
+// limitedBuffer keeps only the most recent maxLen bytes written to it, so a
+// chatty plugin's stderr doesn't grow without bound.
+type limitedBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	maxLen int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Write(p)
+	if excess := b.buf.Len() - b.maxLen; excess > 0 {
+		b.buf.Next(excess)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// pluginRegistry holds every running plugin subprocess, keyed by tool name.
+var pluginRegistry = map[string]*pluginProcess{}
+
+// loadToolsManifest spawns every entry in the tools.json manifest named by
+// RALPH_TOOLS_MANIFEST (or ./tools.json by default) and registers it as a
+// FunctionTool alongside the compiled-in ones. A missing manifest is not an
+// error - plugin tools are optional.
+func loadToolsManifest() {
+	path := os.Getenv("RALPH_TOOLS_MANIFEST")
+	if path == "" {
+		path = defaultToolsManifest
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("reading tools manifest %s: %v", path, err)
+		}
+		return
+	}
+
+	var entries []pluginManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("parsing tools manifest %s: %v", path, err)
+		return
+	}
+
+	// Spawn every plugin (including its describe handshake) concurrently, so
+	// one slow or unresponsive plugin doesn't hold up the rest of startup.
+	procs := make([]*pluginProcess, len(entries))
+	errs := make([]error, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry pluginManifestEntry) {
+			defer wg.Done()
+			procs[i], errs[i] = startPlugin(entry)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	for i, entry := range entries {
+		proc, err := procs[i], errs[i]
+		if err != nil {
+			log.Printf("starting plugin tool %q: %v", entry.Name, err)
+			continue
+		}
+
+		pluginRegistry[entry.Name] = proc
+
+		description := proc.description
+		if description == "" {
+			description = fmt.Sprintf("Plugin tool provided by %s", entry.Command)
+		}
+		schema := proc.schema
+		if schema == nil {
+			schema = entry.Schema
+		}
+
+		availableFunctions = append(availableFunctions, FunctionTool{
+			Name:        entry.Name,
+			Description: description,
+			Parameters:  schema,
+		})
+		log.Printf("Registered plugin tool %q (%s)", entry.Name, entry.Command)
+	}
+}
+
+// startPlugin spawns a plugin's subprocess, starts reading its responses in
+// the background, and performs the "describe" handshake to learn the
+// function it wants to register as.
+func startPlugin(entry pluginManifestEntry) (*pluginProcess, error) {
+	cmd := exec.Command(entry.Command, entry.Args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("opening stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("opening stdout: %w", err)
+	}
+
+	stderr := &limitedBuffer{maxLen: 4096}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting subprocess: %w", err)
+	}
+
+	proc := &pluginProcess{
+		name:    entry.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  stderr,
+		pending: make(map[int]chan jsonrpcResponse),
+	}
+	go proc.readLoop(stdout)
+
+	result, err := proc.callNonDestructive("describe", nil, pluginDescribeTimeout)
+	if err != nil {
+		log.Printf("describing plugin tool %q: %v; falling back to manifest schema", entry.Name, err)
+		return proc, nil
+	}
+
+	var describe pluginDescribeResult
+	if err := json.Unmarshal(result, &describe); err != nil {
+		log.Printf("parsing describe response for plugin tool %q: %v; falling back to manifest schema", entry.Name, err)
+		return proc, nil
+	}
+	proc.description = describe.Description
+	proc.schema = describe.Schema
+
+	return proc, nil
+}
+
+// readLoop reads newline-delimited JSON-RPC responses from the plugin's
+// stdout and routes each one to the pending call waiting on its id.
+func (p *pluginProcess) readLoop(stdout io.ReadCloser) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var resp jsonrpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			continue
+		}
+
+		p.pendingMu.Lock()
+		ch, ok := p.pending[resp.ID]
+		if ok {
+			delete(p.pending, resp.ID)
+		}
+		p.pendingMu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// call sends a JSON-RPC request and waits up to timeout for the matching
+// response. A runaway subprocess (one that never responds) is killed so it
+// can't accumulate indefinitely.
+func (p *pluginProcess) call(method string, params interface{}, timeout time.Duration) (json.RawMessage, error) {
+	return p.doCall(method, params, timeout, true)
+}
+
+// callNonDestructive behaves like call but leaves the subprocess running on
+// timeout instead of killing it. It's for handshake-style calls (describe)
+// that a plugin is allowed to simply not support.
+func (p *pluginProcess) callNonDestructive(method string, params interface{}, timeout time.Duration) (json.RawMessage, error) {
+	return p.doCall(method, params, timeout, false)
+}
+
+func (p *pluginProcess) doCall(method string, params interface{}, timeout time.Duration, killOnTimeout bool) (json.RawMessage, error) {
+	p.writeMu.Lock()
+	p.nextID++
+	id := p.nextID
+
+	ch := make(chan jsonrpcResponse, 1)
+	p.pendingMu.Lock()
+	p.pending[id] = ch
+	p.pendingMu.Unlock()
+
+	data, err := json.Marshal(jsonrpcRequest{ID: id, Method: method, Params: params})
+	if err != nil {
+		p.writeMu.Unlock()
+		return nil, err
+	}
+	_, writeErr := p.stdin.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if writeErr != nil {
+		return nil, fmt.Errorf("writing to plugin %s: %w", p.name, writeErr)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return nil, fmt.Errorf("plugin %s: %s", p.name, resp.Error)
+		}
+		return resp.Result, nil
+	case <-time.After(timeout):
+		p.pendingMu.Lock()
+		delete(p.pending, id)
+		p.pendingMu.Unlock()
+
+		stderr := p.stderr.String()
+		if killOnTimeout {
+			p.kill()
+		}
+		return nil, fmt.Errorf("plugin %s: %q timed out after %s; stderr: %s", p.name, method, timeout, stderr)
+	}
+}
+
+// kill terminates a runaway plugin subprocess.
+func (p *pluginProcess) kill() {
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+// executePluginTool dispatches a function call to its registered plugin
+// subprocess and returns the JSON result (or error envelope) exactly like
+// the compiled-in execute* functions do.
+func executePluginTool(proc *pluginProcess, name string, args map[string]interface{}) string {
+	result, err := proc.call("call", map[string]interface{}{
+		"name":   name,
+		"params": args,
+	}, pluginCallTimeout)
+	if err != nil {
+		resp, _ := json.Marshal(map[string]interface{}{"error": err.Error()})
+		return string(resp)
+	}
+	return string(result)
+}